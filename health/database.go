@@ -0,0 +1,56 @@
+package health
+
+import (
+	"fmt"
+
+	"github.com/safing/portbase/database"
+	"github.com/safing/portbase/database/record"
+	"github.com/safing/portbase/log"
+)
+
+// warningsDB exposes the health registry as a database record collection
+// under "runtime:health/", so the UI can list and subscribe to warnings the
+// same way it already does for notifications.
+var warningsDB = database.NewInterface(&database.Options{
+	Local:    true,
+	Internal: true,
+})
+
+// warningRecord is the persisted representation of a Warning.
+type warningRecord struct {
+	record.Base
+
+	Warning
+}
+
+func init() {
+	OnChange(persistWarning)
+}
+
+func persistWarning(w *Warning) {
+	key := fmt.Sprintf("runtime:health/%s", w.ID)
+
+	// Cleared warnings are removed outright rather than persisted with
+	// Active: false, so "runtime:health/" only ever holds the actionable
+	// list of currently active warnings instead of accumulating every
+	// warning ever raised.
+	if !w.Active {
+		if err := warningsDB.Delete(key); err != nil {
+			log.Warningf("health: failed to delete resolved warning record for %s: %s", w.ID, err)
+		}
+		return
+	}
+
+	rec := &warningRecord{Warning: *w}
+	rec.SetKey(key)
+
+	meta := &record.Meta{}
+	meta.Update()
+	rec.SetMeta(meta)
+
+	if err := warningsDB.Put(rec); err != nil {
+		// A storage failure must not break the in-process tracker; the
+		// warning is still reachable via Get()/Active().
+		log.Warningf("health: failed to persist warning record for %s: %s", w.ID, err)
+	}
+}
@@ -0,0 +1,222 @@
+// Package health implements a process-wide warning tracker modeled after
+// Tailscale's health.Tracker: any part of Portmaster can raise a named
+// warning when it detects a problem, and clear it again once the problem
+// goes away. This gives users an actionable list of current issues instead
+// of having to dig through logs.
+package health
+
+import (
+	"sync"
+	"time"
+
+	"github.com/safing/portbase/log"
+)
+
+// Warning represents the current state of a single named health problem,
+// such as "system resolver bypassed" or "kernel extension not loaded".
+type Warning struct {
+	// ID uniquely identifies the warning, eg. "profile:linked-path-mismatch:_system-resolver".
+	ID string
+	// Component is the subsystem that raised the warning, eg. "profile".
+	Component string
+	// Message is a short, human-readable, actionable description of the problem.
+	Message string
+	// Active is true while the warning condition still applies.
+	Active bool
+	// Since is the time the warning was last raised or cleared.
+	Since time.Time
+}
+
+// Tracker maintains a registry of named warnings and notifies subscribers
+// whenever a warning is raised or cleared.
+type Tracker struct {
+	lock sync.Mutex
+
+	warnings          map[string]*Warning
+	subscribers       []chan *Warning
+	onChangeCallbacks []func(*Warning)
+}
+
+// New returns a new, empty Tracker.
+func New() *Tracker {
+	return &Tracker{
+		warnings: make(map[string]*Warning),
+	}
+}
+
+// global is the default, process-wide tracker backing the package-level
+// helper functions below.
+var global = New()
+
+// OnChange registers fn to be called whenever a warning is set or cleared on
+// the default tracker. It may be called multiple times to register multiple
+// independent consumers (eg. persisting the registry into storage and
+// surfacing updates in the UI); every registered callback is called on every
+// change.
+func OnChange(fn func(*Warning)) {
+	global.OnChange(fn)
+}
+
+// OnChange registers fn to be called whenever a warning is set or cleared.
+// It may be called multiple times; every registered callback is called on
+// every change.
+func (t *Tracker) OnChange(fn func(*Warning)) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.onChangeCallbacks = append(t.onChangeCallbacks, fn)
+}
+
+// Set raises (or refreshes) a warning identified by id on the default
+// tracker. component should name the reporting subsystem (eg. "profile"),
+// and message should be a short, actionable, human-readable explanation.
+func Set(id, component, message string) {
+	global.Set(id, component, message)
+}
+
+// Set raises (or refreshes) a warning identified by id.
+func (t *Tracker) Set(id, component, message string) {
+	t.lock.Lock()
+	existing, ok := t.warnings[id]
+	if ok && existing.Active && existing.Message == message {
+		t.lock.Unlock()
+		return
+	}
+	w := &Warning{
+		ID:        id,
+		Component: component,
+		Message:   message,
+		Active:    true,
+		Since:     time.Now(),
+	}
+	t.warnings[id] = w
+	callbacks := make([]func(*Warning), len(t.onChangeCallbacks))
+	copy(callbacks, t.onChangeCallbacks)
+	t.lock.Unlock()
+
+	log.Warningf("health: %s: %s", component, message)
+	t.notify(w)
+	for _, fn := range callbacks {
+		fn(w)
+	}
+}
+
+// Clear marks the warning identified by id on the default tracker as
+// resolved, if it is currently active. The warning stays tracked, inactive,
+// and is still returned by Get.
+func Clear(id string) {
+	global.Clear(id)
+}
+
+// Clear marks the warning identified by id as resolved, if it is currently
+// active. The warning stays tracked, inactive, and is still returned by Get.
+func (t *Tracker) Clear(id string) {
+	t.lock.Lock()
+	existing, ok := t.warnings[id]
+	if !ok || !existing.Active {
+		t.lock.Unlock()
+		return
+	}
+	w := &Warning{
+		ID:        existing.ID,
+		Component: existing.Component,
+		Message:   existing.Message,
+		Active:    false,
+		Since:     time.Now(),
+	}
+	t.warnings[id] = w
+	callbacks := make([]func(*Warning), len(t.onChangeCallbacks))
+	copy(callbacks, t.onChangeCallbacks)
+	t.lock.Unlock()
+
+	log.Infof("health: %s: resolved: %s", w.Component, w.Message)
+	t.notify(w)
+	for _, fn := range callbacks {
+		fn(w)
+	}
+}
+
+// Get returns the current state of the warning identified by id on the
+// default tracker, if it has ever been set.
+func Get(id string) (*Warning, bool) {
+	return global.Get(id)
+}
+
+// Get returns the current state of the warning identified by id, if it has
+// ever been set.
+func (t *Tracker) Get(id string) (*Warning, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	w, ok := t.warnings[id]
+	return w, ok
+}
+
+// Active returns all currently active warnings on the default tracker.
+func Active() []*Warning {
+	return global.Active()
+}
+
+// Active returns all currently active warnings.
+func (t *Tracker) Active() []*Warning {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	active := make([]*Warning, 0, len(t.warnings))
+	for _, w := range t.warnings {
+		if w.Active {
+			active = append(active, w)
+		}
+	}
+	return active
+}
+
+// Subscribe returns a channel that receives every warning change (both
+// raised and cleared) from the default tracker. Call cancel to stop
+// receiving updates and release the channel.
+func Subscribe() (ch <-chan *Warning, cancel func()) {
+	return global.Subscribe()
+}
+
+// Subscribe returns a channel that receives every warning change (both
+// raised and cleared). Call cancel to stop receiving updates and release
+// the channel.
+func (t *Tracker) Subscribe() (ch <-chan *Warning, cancel func()) {
+	c := make(chan *Warning, 10)
+
+	t.lock.Lock()
+	t.subscribers = append(t.subscribers, c)
+	t.lock.Unlock()
+
+	cancel = func() {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+
+		for i, sub := range t.subscribers {
+			if sub == c {
+				t.subscribers = append(t.subscribers[:i], t.subscribers[i+1:]...)
+				close(c)
+				break
+			}
+		}
+	}
+
+	return c, cancel
+}
+
+// notify fans w out to all current subscribers without blocking on a slow
+// or dead one.
+func (t *Tracker) notify(w *Warning) {
+	t.lock.Lock()
+	subs := make([]chan *Warning, len(t.subscribers))
+	copy(subs, t.subscribers)
+	t.lock.Unlock()
+
+	for _, sub := range subs {
+		select {
+		case sub <- w:
+		default:
+			log.Warningf("health: subscriber channel full, dropping update for %s", w.ID)
+		}
+	}
+}
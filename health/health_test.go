@@ -0,0 +1,83 @@
+package health
+
+import "testing"
+
+func TestTrackerSetAndClear(t *testing.T) {
+	tr := New()
+
+	tr.Set("test:warning", "test", "something is wrong")
+
+	w, ok := tr.Get("test:warning")
+	if !ok {
+		t.Fatal("expected warning to be present after Set")
+	}
+	if !w.Active {
+		t.Fatal("expected warning to be active after Set")
+	}
+
+	active := tr.Active()
+	if len(active) != 1 || active[0].ID != "test:warning" {
+		t.Fatalf("expected exactly one active warning, got %+v", active)
+	}
+
+	tr.Clear("test:warning")
+
+	w, ok = tr.Get("test:warning")
+	if !ok {
+		t.Fatal("expected warning to still be tracked (inactive) after Clear")
+	}
+	if w.Active {
+		t.Fatal("expected warning to be inactive after Clear")
+	}
+	if len(tr.Active()) != 0 {
+		t.Fatalf("expected no active warnings after Clear, got %+v", tr.Active())
+	}
+}
+
+func TestTrackerOnChangeCallsAllCallbacks(t *testing.T) {
+	tr := New()
+
+	var firstCalls, secondCalls int
+	tr.OnChange(func(w *Warning) { firstCalls++ })
+	tr.OnChange(func(w *Warning) { secondCalls++ })
+
+	tr.Set("test:multi", "test", "message")
+	tr.Clear("test:multi")
+
+	if firstCalls != 2 {
+		t.Fatalf("expected first callback to run twice, ran %d times", firstCalls)
+	}
+	if secondCalls != 2 {
+		t.Fatalf("expected second callback to run twice (registering a second OnChange must not displace the first), ran %d times", secondCalls)
+	}
+}
+
+func TestTrackerSubscribe(t *testing.T) {
+	tr := New()
+
+	ch, cancel := tr.Subscribe()
+	defer cancel()
+
+	tr.Set("test:sub", "test", "message")
+
+	select {
+	case w := <-ch:
+		if w.ID != "test:sub" || !w.Active {
+			t.Fatalf("unexpected warning on subscription channel: %+v", w)
+		}
+	default:
+		t.Fatal("expected a warning update on the subscription channel")
+	}
+
+	cancel()
+	tr.Set("test:sub2", "test", "message")
+
+	select {
+	case w, ok := <-ch:
+		if ok {
+			t.Fatalf("expected channel to be closed after cancel, got %+v", w)
+		}
+	default:
+		t.Fatal("expected subscription channel to be closed after cancel")
+	}
+}
@@ -1,12 +1,21 @@
 package main
 
 import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"runtime"
+	"runtime/debug"
 	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/safing/portbase/container"
@@ -16,6 +25,353 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// LogFormat selects the on-disk representation used for control process log files.
+type LogFormat string
+
+const (
+	// LogFormatDSD is the legacy DSD-framed free-form text format.
+	LogFormatDSD LogFormat = "dsd"
+	// LogFormatJSON writes one JSON object per log line and supports rotation.
+	LogFormatJSON LogFormat = "json"
+)
+
+var (
+	logFormatFlag string
+	logMaxSizeMB  int
+	logMaxAgeDays int
+	logMaxBackups int
+)
+
+// RegisterLogFlags registers the logging-related flags shared by all control commands.
+func RegisterLogFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(
+		&logFormatFlag, "log-format", envOrDefault("PORTMASTER_LOG_FORMAT", string(LogFormatDSD)),
+		"log file format to use for control process logs: dsd or json",
+	)
+	cmd.PersistentFlags().IntVar(
+		&logMaxSizeMB, "log-max-size", envOrDefaultInt("PORTMASTER_LOG_MAX_SIZE", 10),
+		"maximum size in megabytes of a json log file before it is rotated",
+	)
+	cmd.PersistentFlags().IntVar(
+		&logMaxAgeDays, "log-max-age", envOrDefaultInt("PORTMASTER_LOG_MAX_AGE", 7),
+		"maximum number of days to retain rotated json log files",
+	)
+	cmd.PersistentFlags().IntVar(
+		&logMaxBackups, "log-max-backups", envOrDefaultInt("PORTMASTER_LOG_MAX_BACKUPS", 5),
+		"maximum number of rotated json log files to retain",
+	)
+}
+
+// rootCmd is the top-level cobra.Command for the portmaster-control binary,
+// executed from main(). Registering the logging flags here via
+// PersistentFlags makes --log-format/--log-max-* available to it and to any
+// subcommand attached to it, and by the time RunE runs, cobra has already
+// parsed them, so currentLogFormat() reflects what the user passed on the
+// command line.
+var rootCmd = &cobra.Command{
+	Use:   "portmaster-control",
+	Short: "control and helper functions for the Portmaster",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logFile := initControlLogFile()
+		if logFile == nil {
+			return fmt.Errorf("failed to initialize control log file")
+		}
+		defer finalizeLogFile(logFile)
+
+		fmt.Fprintln(logFile, "portmaster-control started")
+		return nil
+	},
+}
+
+func init() {
+	RegisterLogFlags(rootCmd)
+}
+
+func envOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envOrDefaultInt(key string, fallback int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
+
+func currentLogFormat() LogFormat {
+	if LogFormat(logFormatFlag) == LogFormatJSON {
+		return LogFormatJSON
+	}
+	return LogFormatDSD
+}
+
+// namedWriteCloser is satisfied by both *os.File and *jsonLogFile, so the
+// control log helpers can work with either log format transparently.
+type namedWriteCloser interface {
+	io.Writer
+	io.Closer
+	Name() string
+}
+
+// jsonLogEntry is the structured representation of a single control log line.
+type jsonLogEntry struct {
+	Timestamp time.Time `json:"ts"`
+	Level     string    `json:"level"`
+	Component string    `json:"component"`
+	PID       int       `json:"pid"`
+	GoID      int       `json:"goid,omitempty"`
+	Message   string    `json:"msg"`
+	Error     string    `json:"err,omitempty"`
+	Stack     string    `json:"stack,omitempty"`
+}
+
+// jsonLogFile is a rotating, JSON-lines log file, modeled after the common
+// lumberjack rotation semantics (max size, max age, max backups), including
+// compression of rotated segments.
+type jsonLogFile struct {
+	mu sync.Mutex
+
+	file *os.File
+	size int64
+
+	dir        string
+	prefix     string
+	identifier string
+	version    string
+
+	maxSizeMB  int
+	maxAgeDays int
+	maxBackups int
+}
+
+func newJSONLogFile(dir, prefix, identifier, version string) *jsonLogFile {
+	w := &jsonLogFile{
+		dir:        dir,
+		prefix:     prefix,
+		identifier: identifier,
+		version:    version,
+		maxSizeMB:  logMaxSizeMB,
+		maxAgeDays: logMaxAgeDays,
+		maxBackups: logMaxBackups,
+	}
+
+	if err := w.openNew(); err != nil {
+		log.Printf("failed to create json log file in %s: %s\n", dir, err)
+		return nil
+	}
+
+	return w
+}
+
+func (w *jsonLogFile) Name() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return ""
+	}
+	return w.file.Name()
+}
+
+func (w *jsonLogFile) openNew() error {
+	// Nanosecond precision keeps segments rotated within the same second
+	// from reusing (and overwriting) an earlier segment's name.
+	path := filepath.Join(w.dir, fmt.Sprintf("%s.%s.log", w.prefix, time.Now().UTC().Format("2006-01-02-15-04-05.000000000")))
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0444)
+	if err != nil {
+		return err
+	}
+	w.file = f
+	w.size = 0
+
+	return w.writeEntry(&jsonLogEntry{
+		Timestamp: time.Now(),
+		Level:     "info",
+		Component: w.identifier,
+		PID:       os.Getpid(),
+		Message:   fmt.Sprintf("executing %s version %s on %s %s", w.identifier, w.version, runtime.GOOS, runtime.GOARCH),
+	})
+}
+
+// Write implements io.Writer by wrapping plain-text log lines (as produced by
+// log.Printf and friends) in a jsonLogEntry.
+func (w *jsonLogFile) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.writeEntry(&jsonLogEntry{
+		Timestamp: time.Now(),
+		Level:     "info",
+		Component: w.identifier,
+		PID:       os.Getpid(),
+		GoID:      currentGoroutineID(),
+		Message:   strings.TrimRight(string(p), "\n"),
+	})
+	return len(p), err
+}
+
+// writeEntry marshals and appends entry, rotating the file first if it would
+// grow past maxSizeMB. Callers must hold w.mu.
+func (w *jsonLogFile) writeEntry(entry *jsonLogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if w.maxSizeMB > 0 && w.size+int64(len(data)) > int64(w.maxSizeMB)*1024*1024 {
+		if err := w.rotateLocked(); err != nil {
+			log.Printf("failed to rotate log file %s: %s\n", w.file.Name(), err)
+		}
+	}
+
+	n, err := w.file.Write(data)
+	w.size += int64(n)
+	return err
+}
+
+// rotateLocked closes the current segment, compresses it and opens a new one.
+// Callers must hold w.mu.
+func (w *jsonLogFile) rotateLocked() error {
+	oldPath := w.file.Name()
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	if err := compressLogFile(oldPath); err != nil {
+		log.Printf("failed to compress rotated log file %s: %s\n", oldPath, err)
+	}
+	if err := enforceLogRetention(w.dir, w.prefix, w.maxBackups, w.maxAgeDays); err != nil {
+		log.Printf("failed to enforce log retention in %s: %s\n", w.dir, err)
+	}
+
+	return w.openNew()
+}
+
+// Close closes the current segment, compresses it and enforces the retention
+// window against logsRoot, so long-lived control processes don't fill disk.
+func (w *jsonLogFile) Close() error {
+	w.mu.Lock()
+	var path string
+	var err error
+	if w.file != nil {
+		path = w.file.Name()
+		err = w.file.Close()
+	}
+	w.mu.Unlock()
+
+	if path != "" {
+		if cErr := compressLogFile(path); cErr != nil {
+			log.Printf("failed to compress log file %s: %s\n", path, cErr)
+		}
+	}
+	if rErr := enforceLogRetention(w.dir, w.prefix, w.maxBackups, w.maxAgeDays); rErr != nil {
+		log.Printf("failed to enforce log retention in %s: %s\n", w.dir, rErr)
+	}
+
+	return err
+}
+
+// compressLogFile gzip-compresses path to path+".gz" and removes the original.
+func compressLogFile(path string) error {
+	if strings.HasSuffix(path, ".gz") {
+		return nil
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dstPath := path + ".gz"
+	dst, err := os.OpenFile(dstPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0444)
+	if err != nil {
+		return err
+	}
+
+	gzw := gzip.NewWriter(dst)
+	_, copyErr := io.Copy(gzw, bufio.NewReader(src))
+	closeErr := gzw.Close()
+	dst.Close()
+
+	switch {
+	case copyErr != nil:
+		_ = os.Remove(dstPath)
+		return copyErr
+	case closeErr != nil:
+		_ = os.Remove(dstPath)
+		return closeErr
+	}
+
+	return os.Remove(path)
+}
+
+// enforceLogRetention removes compressed segments for prefix in dir that
+// exceed maxBackups or are older than maxAgeDays. Segment file names are
+// "<prefix>.<timestamp>.log.gz", so lexical order is also chronological
+// order. Segments of a longer prefix that starts with prefix (eg.
+// "control.error" for "control") are not counted.
+func enforceLogRetention(dir, prefix string, maxBackups, maxAgeDays int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var segments []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix+".") || !strings.HasSuffix(name, ".log.gz") {
+			continue
+		}
+		if rest := name[len(prefix)+1:]; rest == "" || rest[0] < '0' || rest[0] > '9' {
+			continue
+		}
+		segments = append(segments, name)
+	}
+	sort.Strings(segments)
+
+	cutoff := time.Now().AddDate(0, 0, -maxAgeDays)
+	for i, name := range segments {
+		path := filepath.Join(dir, name)
+
+		keepByCount := maxBackups <= 0 || len(segments)-i <= maxBackups
+		if !keepByCount {
+			_ = os.Remove(path)
+			continue
+		}
+
+		if maxAgeDays > 0 {
+			if stat, statErr := os.Stat(path); statErr == nil && stat.ModTime().Before(cutoff) {
+				_ = os.Remove(path)
+			}
+		}
+	}
+
+	return nil
+}
+
+// currentGoroutineID extracts the numeric goroutine ID from the current
+// goroutine's stack trace header ("goroutine 123 [running]:").
+func currentGoroutineID() int {
+	stack := debug.Stack()
+	fields := strings.Fields(string(stack))
+	if len(fields) < 2 {
+		return 0
+	}
+	id, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
 func initializeLogFile(logFilePath string, identifier string, version string) *os.File {
 	logFile, err := os.OpenFile(logFilePath, os.O_RDWR|os.O_CREATE, 0444)
 	if err != nil {
@@ -35,7 +391,7 @@ func initializeLogFile(logFilePath string, identifier string, version string) *o
 	metaSection, err := dsd.Dump(meta, dsd.JSON)
 	if err != nil {
 		log.Printf("failed to serialize header for log file %s: %s\n", logFilePath, err)
-		finalizeLogFile(logFile, logFilePath)
+		finalizeLogFile(logFile)
 		return nil
 	}
 	c.AppendAsBlock(metaSection)
@@ -46,33 +402,45 @@ func initializeLogFile(logFilePath string, identifier string, version string) *o
 	_, err = logFile.Write(c.CompileData())
 	if err != nil {
 		log.Printf("failed to write header for log file %s: %s\n", logFilePath, err)
-		finalizeLogFile(logFile, logFilePath)
+		finalizeLogFile(logFile)
 		return nil
 	}
 
 	return logFile
 }
 
-func finalizeLogFile(logFile *os.File, logFilePath string) {
+// finalizeLogFile closes logFile. For the legacy DSD format, it also deletes
+// the file if it never grew past the header, as before. For JSON log files,
+// rotation, compression and retention enforcement already happened as part
+// of Close().
+func finalizeLogFile(logFile namedWriteCloser) {
+	path := logFile.Name()
+
 	err := logFile.Close()
 	if err != nil {
-		log.Printf("failed to close log file %s: %s\n", logFilePath, err)
+		log.Printf("failed to close log file %s: %s\n", path, err)
+	}
+
+	if _, isJSON := logFile.(*jsonLogFile); isJSON {
+		return
 	}
 
 	// check file size
-	stat, err := os.Stat(logFilePath)
+	stat, err := os.Stat(path)
 	if err == nil {
 		// delete if file is smaller than
 		if stat.Size() < 200 { // header + info is about 150 bytes
-			err := os.Remove(logFilePath)
+			err := os.Remove(path)
 			if err != nil {
-				log.Printf("failed to delete empty log file %s: %s\n", logFilePath, err)
+				log.Printf("failed to delete empty log file %s: %s\n", path, err)
 			}
 		}
 	}
 }
 
-func initControlLogFile() *os.File {
+// openControlLogFile opens a control log file using the configured format,
+// with filenameSuffix distinguishing the regular, error and stack logs.
+func openControlLogFile(filenameSuffix string) namedWriteCloser {
 	// check logging dir
 	logFileBasePath := filepath.Join(logsRoot.Path, "control")
 	err := logsRoot.EnsureAbsPath(logFileBasePath)
@@ -80,9 +448,25 @@ func initControlLogFile() *os.File {
 		log.Printf("failed to check/create log file folder %s: %s\n", logFileBasePath, err)
 	}
 
-	// open log file
-	logFilePath := filepath.Join(logFileBasePath, fmt.Sprintf("%s.log", time.Now().UTC().Format("2006-01-02-15-04-05")))
-	return initializeLogFile(logFilePath, "control/portmaster-control", info.Version())
+	if currentLogFormat() == LogFormatJSON {
+		jsonFile := newJSONLogFile(logFileBasePath, "control"+filenameSuffix, "control/portmaster-control", info.Version())
+		if jsonFile == nil {
+			return nil
+		}
+		return jsonFile
+	}
+
+	// open log file (legacy DSD format, kept for backwards compatibility)
+	logFilePath := filepath.Join(logFileBasePath, fmt.Sprintf("%s%s.log", time.Now().UTC().Format("2006-01-02-15-04-05"), filenameSuffix))
+	logFile := initializeLogFile(logFilePath, "control/portmaster-control", info.Version())
+	if logFile == nil {
+		return nil
+	}
+	return logFile
+}
+
+func initControlLogFile() namedWriteCloser {
+	return openControlLogFile("")
 }
 
 //nolint:deadcode,unused // false positive on linux, currently used by windows only
@@ -92,44 +476,56 @@ func logControlError(cErr error) {
 		return
 	}
 
-	// check logging dir
-	logFileBasePath := filepath.Join(logsRoot.Path, "control")
-	err := logsRoot.EnsureAbsPath(logFileBasePath)
-	if err != nil {
-		log.Printf("failed to check/create log file folder %s: %s\n", logFileBasePath, err)
+	errorFile := openControlLogFile(".error")
+	if errorFile == nil {
+		return
 	}
+	defer finalizeLogFile(errorFile)
 
-	// open log file
-	logFilePath := filepath.Join(logFileBasePath, fmt.Sprintf("%s.error.log", time.Now().UTC().Format("2006-01-02-15-04-05")))
-	errorFile := initializeLogFile(logFilePath, "control/portmaster-control", info.Version())
-	if errorFile == nil {
+	if jsonFile, ok := errorFile.(*jsonLogFile); ok {
+		jsonFile.mu.Lock()
+		_ = jsonFile.writeEntry(&jsonLogEntry{
+			Timestamp: time.Now(),
+			Level:     "error",
+			Component: "control/portmaster-control",
+			PID:       os.Getpid(),
+			GoID:      currentGoroutineID(),
+			Message:   "control process error",
+			Error:     cErr.Error(),
+		})
+		jsonFile.mu.Unlock()
 		return
 	}
 
-	// write error and close
 	fmt.Fprintln(errorFile, cErr.Error())
-	errorFile.Close()
 }
 
 //nolint:deadcode,unused // TODO
 func logControlStack() {
-	// check logging dir
-	logFileBasePath := filepath.Join(logsRoot.Path, "control")
-	err := logsRoot.EnsureAbsPath(logFileBasePath)
-	if err != nil {
-		log.Printf("failed to check/create log file folder %s: %s\n", logFileBasePath, err)
+	errorFile := openControlLogFile(".stack")
+	if errorFile == nil {
+		return
 	}
+	defer finalizeLogFile(errorFile)
 
-	// open log file
-	logFilePath := filepath.Join(logFileBasePath, fmt.Sprintf("%s.stack.log", time.Now().UTC().Format("2006-01-02-15-04-05")))
-	errorFile := initializeLogFile(logFilePath, "control/portmaster-control", info.Version())
-	if errorFile == nil {
+	if jsonFile, ok := errorFile.(*jsonLogFile); ok {
+		var buf strings.Builder
+		_ = pprof.Lookup("goroutine").WriteTo(&buf, 2)
+
+		jsonFile.mu.Lock()
+		_ = jsonFile.writeEntry(&jsonLogEntry{
+			Timestamp: time.Now(),
+			Level:     "info",
+			Component: "control/portmaster-control",
+			PID:       os.Getpid(),
+			Message:   "control process goroutine dump",
+			Stack:     buf.String(),
+		})
+		jsonFile.mu.Unlock()
 		return
 	}
 
-	// write error and close
 	_ = pprof.Lookup("goroutine").WriteTo(errorFile, 2)
-	errorFile.Close()
 }
 
 //nolint:deadcode,unused // false positive on linux, currently used by windows only
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestRegisterLogFlagsSetsFormat(t *testing.T) {
+	cmd := &cobra.Command{Use: "test"}
+	RegisterLogFlags(cmd)
+
+	if err := cmd.ParseFlags([]string{"--log-format=json"}); err != nil {
+		t.Fatalf("failed to parse flags: %s", err)
+	}
+
+	if got := currentLogFormat(); got != LogFormatJSON {
+		t.Fatalf("expected log format %q after parsing --log-format=json, got %q", LogFormatJSON, got)
+	}
+}
+
+func TestRootCmdHasLogFlagsRegistered(t *testing.T) {
+	// rootCmd is the command main() actually calls Execute() on, and it
+	// registers the logging flags in this package's init(). This guards
+	// against RegisterLogFlags being wired into some parallel stub instead
+	// of the command the binary really runs.
+	flag := rootCmd.PersistentFlags().Lookup("log-format")
+	if flag == nil {
+		t.Fatal("expected rootCmd to have the --log-format persistent flag registered")
+	}
+
+	if err := rootCmd.ParseFlags([]string{"--log-format=json"}); err != nil {
+		t.Fatalf("failed to parse --log-format=json on rootCmd: %s", err)
+	}
+	if got := currentLogFormat(); got != LogFormatJSON {
+		t.Fatalf("expected rootCmd's --log-format=json to select LogFormatJSON, got %q", got)
+	}
+}
+
+func TestLogFormatFlagEndToEndProducesRotatingJSONFile(t *testing.T) {
+	dir := t.TempDir()
+
+	cmd := &cobra.Command{Use: "test"}
+	RegisterLogFlags(cmd)
+	if err := cmd.ParseFlags([]string{"--log-format=json", "--log-max-size=1", "--log-max-backups=2"}); err != nil {
+		t.Fatalf("failed to parse flags: %s", err)
+	}
+
+	if got := currentLogFormat(); got != LogFormatJSON {
+		t.Fatalf("expected --log-format=json to select LogFormatJSON, got %q", got)
+	}
+
+	w := newJSONLogFile(dir, "control-e2e", "test/control", "0.0.0-test")
+	if w == nil {
+		t.Fatal("expected newJSONLogFile to succeed with --log-format=json in effect")
+	}
+
+	line := strings.Repeat("x", 1024)
+	for i := 0; i < 4000; i++ {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("failed to write log line: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close json log file: %s", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read log dir: %s", err)
+	}
+
+	var gzFiles int
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".log.gz") {
+			gzFiles++
+		}
+	}
+	if gzFiles == 0 {
+		t.Fatal("expected --log-format=json to produce at least one rotated, compressed segment")
+	}
+}
+
+func TestJSONLogFileRotatesCompressesAndPrunes(t *testing.T) {
+	dir := t.TempDir()
+
+	w := &jsonLogFile{
+		dir:        dir,
+		prefix:     "control-test",
+		identifier: "test/control",
+		version:    "0.0.0-test",
+		maxSizeMB:  1,
+		maxAgeDays: 7,
+		maxBackups: 2,
+	}
+	if err := w.openNew(); err != nil {
+		t.Fatalf("failed to open json log file: %s", err)
+	}
+
+	// Write enough to trigger several rotations past the configured size limit.
+	line := strings.Repeat("x", 1024)
+	for i := 0; i < 4000; i++ {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("failed to write log line: %s", err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close json log file: %s", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read log dir: %s", err)
+	}
+
+	var gzFiles []string
+	for _, entry := range entries {
+		switch {
+		case strings.HasSuffix(entry.Name(), ".log.gz"):
+			gzFiles = append(gzFiles, entry.Name())
+		case strings.HasSuffix(entry.Name(), ".log"):
+			t.Errorf("expected all segments to be compressed after Close, found raw segment %s", entry.Name())
+		}
+	}
+
+	if len(gzFiles) == 0 {
+		t.Fatal("expected at least one compressed rotated segment, found none")
+	}
+	if len(gzFiles) > w.maxBackups {
+		t.Fatalf("expected retention to cap compressed segments at %d, found %d", w.maxBackups, len(gzFiles))
+	}
+
+	// Verify a surviving compressed segment actually contains valid,
+	// structured JSON log lines.
+	f, err := os.Open(filepath.Join(dir, gzFiles[0]))
+	if err != nil {
+		t.Fatalf("failed to open rotated segment: %s", err)
+	}
+	defer f.Close()
+
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("failed to open gzip reader: %s", err)
+	}
+	defer gzr.Close()
+
+	scanner := bufio.NewScanner(gzr)
+	if !scanner.Scan() {
+		t.Fatalf("expected at least one line in rotated segment %s", gzFiles[0])
+	}
+
+	var entry jsonLogEntry
+	if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+		t.Fatalf("failed to unmarshal json log entry: %s", err)
+	}
+	if entry.Component != "test/control" {
+		t.Fatalf("unexpected component in log entry: %q", entry.Component)
+	}
+}
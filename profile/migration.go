@@ -0,0 +1,232 @@
+package profile
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/safing/portbase/log"
+)
+
+// CurrentSchemaVersion is the schema version Migrate brings profiles up to,
+// and the one special profiles created by getSpecialProfile start out at.
+// Profiles created with New start at version 0. Bump it whenever a new
+// Migration is registered for it.
+const CurrentSchemaVersion = 3
+
+// Migration describes a single, non-destructive upgrade step for the
+// profile config schema, taking a profile from schema version From to
+// schema version To. Modeled on AdGuardHome's config upgrade chain: each
+// step is small, targeted and safe to run even on profiles that were
+// already edited by the user (eg. filling in a new option default, or
+// renaming a key), since it must never touch `LastEdited` semantics or
+// overwrite anything the user explicitly set.
+type Migration struct {
+	From int
+	To   int
+	// Apply performs the migration. It may assume that profile is currently
+	// at schema version From.
+	Apply func(profile *Profile) error
+}
+
+var (
+	migrationsLock sync.Mutex
+	migrations     []Migration
+)
+
+// RegisterMigration adds m to the global migration registry. It is meant to
+// be called from package init functions.
+func RegisterMigration(m Migration) {
+	migrationsLock.Lock()
+	defer migrationsLock.Unlock()
+
+	migrations = append(migrations, m)
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].From < migrations[j].From
+	})
+}
+
+// Migrate runs all registered migrations applicable to profile, in order,
+// starting at profile.SchemaVersion, and records the resulting version on
+// the profile. It is all-or-nothing: migrations run against a copy of
+// profile, which is only committed back once every applicable step has
+// succeeded. This way a failing step never leaves profile stuck half
+// upgraded at an intermediate schema version, which would otherwise cause
+// the same failing step to be retried (and re-reported) forever.
+// profile.LastEdited is preserved, as migrations only ever apply
+// non-destructive changes (new option defaults, renamed keys) and must not
+// look like a user edit.
+func Migrate(profile *Profile) error {
+	if profile == nil {
+		return nil
+	}
+
+	migrationsLock.Lock()
+	applicable := make([]Migration, len(migrations))
+	copy(applicable, migrations)
+	migrationsLock.Unlock()
+
+	// Work on a copy, including its own copy of Config, so a failing
+	// migration never mutates the caller's profile.
+	working := *profile
+	working.Config = copyConfig(profile.Config)
+
+	for _, m := range applicable {
+		if working.SchemaVersion != m.From {
+			continue
+		}
+
+		if err := m.Apply(&working); err != nil {
+			return fmt.Errorf("profile: migration v%d->v%d failed for %s: %w", m.From, m.To, profile.ScopedID(), err)
+		}
+
+		working.SchemaVersion = m.To
+		log.Infof("profile: migrated %s from schema v%d to v%d", profile.ScopedID(), m.From, m.To)
+	}
+
+	working.LastEdited = profile.LastEdited
+	*profile = working
+
+	return nil
+}
+
+// copyConfig returns a copy of config that is fully isolated from the
+// original: besides copying the map itself, it also clones any []string or
+// []interface{} value (the two shapes a list-typed config option can take,
+// see toStringList), since appendDefaultEndpointRule may append to such a
+// slice in place when it has spare capacity. Without this, a failed
+// migration could mutate the original profile's config through a shared
+// backing array even though Migrate never commits the copy back.
+func copyConfig(config map[string]interface{}) map[string]interface{} {
+	if config == nil {
+		return nil
+	}
+
+	copied := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		switch list := v.(type) {
+		case []string:
+			clone := make([]string, len(list))
+			copy(clone, list)
+			copied[k] = clone
+		case []interface{}:
+			clone := make([]interface{}, len(list))
+			copy(clone, list)
+			copied[k] = clone
+		default:
+			copied[k] = v
+		}
+	}
+	return copied
+}
+
+// setDefaultConfigOption sets key in profile.Config to value, unless the
+// key is already present - so a migration never overwrites a value the
+// user (or an earlier migration) already set.
+func setDefaultConfigOption(profile *Profile, key string, value interface{}) {
+	if profile.Config == nil {
+		profile.Config = make(map[string]interface{})
+	}
+	if _, ok := profile.Config[key]; !ok {
+		profile.Config[key] = value
+	}
+}
+
+// appendDefaultEndpointRule appends rule to the string list stored at key in
+// profile.Config, unless it is already present.
+func appendDefaultEndpointRule(profile *Profile, key, rule string) error {
+	if profile.Config == nil {
+		profile.Config = make(map[string]interface{})
+	}
+
+	raw, ok := profile.Config[key]
+	if !ok {
+		profile.Config[key] = []string{rule}
+		return nil
+	}
+
+	list, err := toStringList(raw)
+	if err != nil {
+		return fmt.Errorf("config option %s: %w", key, err)
+	}
+
+	for _, existing := range list {
+		if existing == rule {
+			return nil
+		}
+	}
+
+	profile.Config[key] = append(list, rule)
+	return nil
+}
+
+// toStringList normalizes a config value that is expected to hold a list of
+// strings. Profiles created fresh in code store these as []string, but
+// profiles loaded back from the database deserialize generic lists as
+// []interface{}, so both representations must be accepted.
+func toStringList(raw interface{}) ([]string, error) {
+	switch v := raw.(type) {
+	case []string:
+		return v, nil
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, entry := range v {
+			s, ok := entry.(string)
+			if !ok {
+				return nil, fmt.Errorf("unexpected element type %T", entry)
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("unexpected type %T", raw)
+	}
+}
+
+func init() {
+	// v0->v1: bootstrap profiles that predate schema versioning (their zero
+	// value SchemaVersion looks identical to "never migrated") onto v1, so
+	// the migrations below can take over from there.
+	RegisterMigration(Migration{
+		From: 0,
+		To:   1,
+		Apply: func(profile *Profile) error {
+			return nil
+		},
+	})
+
+	// v1->v2: the system resolver profile gained explicit allow rules for
+	// mDNS/LLMNR/SSDP replies, so profiles created before that existed need
+	// them filled in.
+	RegisterMigration(Migration{
+		From: 1,
+		To:   2,
+		Apply: func(profile *Profile) error {
+			if profile.ID != SystemResolverProfileID {
+				return nil
+			}
+
+			setDefaultConfigOption(profile, CfgOptionServiceEndpointsKey, []string{
+				"+ Localhost",    // Allow everything from localhost.
+				"+ LAN UDP/5353", // Allow inbound mDNS requests and multicast replies.
+				"+ LAN UDP/5355", // Allow inbound LLMNR requests and multicast replies.
+				"+ LAN UDP/1900", // Allow inbound SSDP requests and multicast replies.
+			})
+			return nil
+		},
+	})
+
+	// v2->v3: the Portmaster App profile gained an explicit allow rule for
+	// .safing.io, used for update and support links opened from the UI.
+	RegisterMigration(Migration{
+		From: 2,
+		To:   3,
+		Apply: func(profile *Profile) error {
+			if profile.ID != PortmasterAppProfileID {
+				return nil
+			}
+
+			return appendDefaultEndpointRule(profile, CfgOptionEndpointsKey, "+ .safing.io")
+		},
+	})
+}
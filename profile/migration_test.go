@@ -0,0 +1,145 @@
+package profile
+
+import (
+	"errors"
+	"testing"
+)
+
+// snapshotMigrations saves the current package-level migrations registry and
+// restores it once the test finishes, so a test that registers a throwaway
+// Migration (eg. to simulate a failing step) doesn't leak it into other
+// tests in the same binary.
+func snapshotMigrations(t *testing.T) {
+	t.Helper()
+
+	migrationsLock.Lock()
+	saved := make([]Migration, len(migrations))
+	copy(saved, migrations)
+	migrationsLock.Unlock()
+
+	t.Cleanup(func() {
+		migrationsLock.Lock()
+		migrations = saved
+		migrationsLock.Unlock()
+	})
+}
+
+// dbRoundTrippedAppProfile returns a PortmasterAppProfileID profile in the
+// shape it comes back in after a save/load cycle through the database: list
+// config values deserialize as []interface{}, not []string.
+func dbRoundTrippedAppProfile() *Profile {
+	return &Profile{
+		ID:            PortmasterAppProfileID,
+		Source:        SourceLocal,
+		SchemaVersion: 2,
+		Config: map[string]interface{}{
+			CfgOptionDefaultActionKey: "block",
+			CfgOptionEndpointsKey: []interface{}{
+				"+ Localhost",
+			},
+		},
+	}
+}
+
+func TestMigrateHandlesDatabaseRoundTrippedLists(t *testing.T) {
+	profile := dbRoundTrippedAppProfile()
+
+	if err := Migrate(profile); err != nil {
+		t.Fatalf("Migrate failed on a database round-tripped profile: %s", err)
+	}
+
+	if profile.SchemaVersion != CurrentSchemaVersion {
+		t.Fatalf("expected schema version %d after migrating, got %d", CurrentSchemaVersion, profile.SchemaVersion)
+	}
+
+	list, err := toStringList(profile.Config[CfgOptionEndpointsKey])
+	if err != nil {
+		t.Fatalf("endpoints config is not a string list after migration: %s", err)
+	}
+
+	var foundSafingIO bool
+	for _, rule := range list {
+		if rule == "+ .safing.io" {
+			foundSafingIO = true
+		}
+	}
+	if !foundSafingIO {
+		t.Fatalf("expected migrated endpoints to contain \"+ .safing.io\", got %v", list)
+	}
+}
+
+func TestCopyConfigIsolatesSliceValues(t *testing.T) {
+	// Build the slice with spare capacity, so an in-place append by the copy
+	// would otherwise silently write into the original's backing array.
+	original := make([]string, 1, 4)
+	original[0] = "+ Localhost"
+	config := map[string]interface{}{
+		CfgOptionEndpointsKey: original,
+	}
+	if cap(original) == len(original) {
+		t.Fatal("test setup invalid: need spare capacity to catch in-place mutation")
+	}
+
+	copied := copyConfig(config)
+	list, ok := copied[CfgOptionEndpointsKey].([]string)
+	if !ok {
+		t.Fatalf("expected copied endpoints to stay a []string, got %T", copied[CfgOptionEndpointsKey])
+	}
+	list = append(list, "+ mutated")
+	copied[CfgOptionEndpointsKey] = list
+
+	if len(original) != 1 {
+		t.Fatalf("expected original slice to be unaffected by appending to the copy, got %v", original)
+	}
+}
+
+func TestMigrateIsAllOrNothing(t *testing.T) {
+	snapshotMigrations(t)
+
+	// Register a migration that always fails, at a schema version no real
+	// profile ever rests at (CurrentSchemaVersion is the highest any
+	// up-to-date profile reaches), so it can't be picked up by unrelated
+	// profiles or tests, and is rolled back via snapshotMigrations either way.
+	const failingFrom = CurrentSchemaVersion + 1000
+	boom := errors.New("boom")
+
+	RegisterMigration(Migration{
+		From: failingFrom,
+		To:   failingFrom + 1,
+		Apply: func(profile *Profile) error {
+			return boom
+		},
+	})
+
+	profile := &Profile{
+		ID:            PortmasterAppProfileID,
+		Source:        SourceLocal,
+		SchemaVersion: failingFrom,
+		Config:        map[string]interface{}{},
+	}
+
+	err := Migrate(profile)
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected Migrate to surface the failing step's error, got %v", err)
+	}
+
+	if profile.SchemaVersion != failingFrom {
+		t.Fatalf("expected SchemaVersion to stay at %d after a failed migration, got %d", failingFrom, profile.SchemaVersion)
+	}
+}
+
+func TestMigrateLeavesFreshProfilesAlone(t *testing.T) {
+	profile := &Profile{
+		ID:            UnidentifiedProfileID,
+		Source:        SourceLocal,
+		SchemaVersion: CurrentSchemaVersion,
+	}
+
+	if err := Migrate(profile); err != nil {
+		t.Fatalf("Migrate failed on an up-to-date profile: %s", err)
+	}
+
+	if profile.SchemaVersion != CurrentSchemaVersion {
+		t.Fatalf("expected SchemaVersion to stay at %d, got %d", CurrentSchemaVersion, profile.SchemaVersion)
+	}
+}
@@ -0,0 +1,73 @@
+package profile
+
+import "fmt"
+
+// Source describes where a profile originates from.
+type Source string
+
+const (
+	// SourceLocal is used for profiles that only exist on this device, such
+	// as the special profiles managed by this package.
+	SourceLocal Source = "local"
+)
+
+// Config option keys used in a Profile's Config map. These mirror the keys
+// understood by the config/option system; only the subset needed by the
+// special profiles in this package is declared here.
+const (
+	// CfgOptionDefaultActionKey sets the profile's default action (eg.
+	// "permit", "block", "prompt") for connections that don't match any rule.
+	CfgOptionDefaultActionKey = "defaultAction"
+	// CfgOptionEndpointsKey sets the outgoing endpoint rules.
+	CfgOptionEndpointsKey = "endpoints"
+	// CfgOptionServiceEndpointsKey sets the incoming (listening) endpoint rules.
+	CfgOptionServiceEndpointsKey = "serviceEndpoints"
+	// CfgOptionFilterListsKey sets the filter list IDs to enforce.
+	CfgOptionFilterListsKey = "filterLists"
+)
+
+// Profile holds the configuration and metadata for an application, or, in
+// the case of the special profiles in this package, a well-known system
+// process.
+type Profile struct {
+	// ID is the unique profile ID.
+	ID string
+	// Source describes where this profile originates from.
+	Source Source
+	// Name is the human readable name shown in the UI.
+	Name string
+	// Description is a short explanation shown in the UI.
+	Description string
+	// LinkedPath is the path of the binary this profile is linked to.
+	LinkedPath string
+	// Internal marks profiles that belong to Portmaster itself and are
+	// hidden from the regular app list.
+	Internal bool
+	// Created holds the unix timestamp the profile was first created at.
+	Created int64
+	// LastEdited holds the unix timestamp of the last user edit, or zero if
+	// the profile was never edited by the user.
+	LastEdited int64
+	// SchemaVersion is the version of the config schema this profile's
+	// Config currently conforms to. See Migrate.
+	SchemaVersion int
+	// Config holds profile-specific config option overrides.
+	Config map[string]interface{}
+}
+
+// New returns a new Profile for the given source, ID and linked binary
+// path, seeded with the given default config options.
+func New(source Source, id, linkedPath string, config map[string]interface{}) *Profile {
+	return &Profile{
+		ID:         id,
+		Source:     source,
+		LinkedPath: linkedPath,
+		Config:     config,
+	}
+}
+
+// ScopedID returns the profile ID prefixed with its source, eg.
+// "local/_system-resolver", for use in logs and error messages.
+func (p *Profile) ScopedID() string {
+	return fmt.Sprintf("%s/%s", p.Source, p.ID)
+}
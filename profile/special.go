@@ -1,9 +1,15 @@
 package profile
 
 import (
-	"time"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 
 	"github.com/safing/portbase/log"
+
+	"github.com/safing/portmaster/health"
 )
 
 const (
@@ -62,32 +68,225 @@ If you think you might have messed up the settings of the System DNS Client, jus
 	PortmasterNotifierProfileDescription = `This is the Portmaster UI Tray Notifier.`
 )
 
+// SpecialProfileProvider supplies everything needed to create and keep a
+// special profile up to date for one recognized binary or group of
+// binaries (eg. a system DNS resolver, or Portmaster's own UI). Providers
+// are registered per-OS, so contributors can teach Portmaster about a new
+// system daemon without touching the core special-profile handling.
+type SpecialProfileProvider interface {
+	// ID returns the special profile ID this provider is responsible for,
+	// eg. "_system-resolver".
+	ID() string
+	// Metadata returns the profile name and description to use for the
+	// given binary path.
+	Metadata(binaryPath string) (name, description string)
+	// DefaultConfig returns the default config options applied to a freshly
+	// created profile for this provider. May return nil.
+	DefaultConfig() map[string]interface{}
+	// Applies returns whether this provider is relevant on the given
+	// runtime.GOOS value.
+	Applies(goos string) bool
+	// Matches returns whether binaryPath is the binary this provider is
+	// responsible for, eg. "svchost.exe" for the Windows Service Host
+	// provider.
+	Matches(binaryPath string) bool
+}
+
+var (
+	specialProfileProvidersLock sync.Mutex
+	specialProfileProviders     = make(map[string]SpecialProfileProvider)
+)
+
+// RegisterSpecialProfileProvider adds p to the special profile registry. It
+// is meant to be called from package init functions. Registering a provider
+// for an ID that is already registered replaces the previous one.
+func RegisterSpecialProfileProvider(p SpecialProfileProvider) {
+	specialProfileProvidersLock.Lock()
+	defer specialProfileProvidersLock.Unlock()
+
+	specialProfileProviders[p.ID()] = p
+}
+
+// getSpecialProfileProvider returns the provider for profileID, if one is
+// registered and applicable to the current OS.
+func getSpecialProfileProvider(profileID string) SpecialProfileProvider {
+	specialProfileProvidersLock.Lock()
+	defer specialProfileProvidersLock.Unlock()
+
+	p, ok := specialProfileProviders[profileID]
+	if !ok || !p.Applies(runtime.GOOS) {
+		return nil
+	}
+	return p
+}
+
+// matchBinaryProvider returns a registered provider applicable to the
+// current OS whose Matches reports true for binaryPath, or nil if none do.
+// If several providers match, which one is returned is not defined.
+func matchBinaryProvider(binaryPath string) SpecialProfileProvider {
+	specialProfileProvidersLock.Lock()
+	defer specialProfileProvidersLock.Unlock()
+
+	for _, p := range specialProfileProviders {
+		if p.Applies(runtime.GOOS) && p.Matches(binaryPath) {
+			return p
+		}
+	}
+	return nil
+}
+
+// matchesBinaryName returns whether binaryPath's file name matches one of
+// names, case-insensitively. It is shared by the provider implementations
+// below, since binary name matching needs to be case-insensitive on Windows
+// and is harmless elsewhere.
+func matchesBinaryName(binaryPath string, names ...string) bool {
+	base := filepath.Base(binaryPath)
+	for _, name := range names {
+		if strings.EqualFold(base, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectSpecialProfile returns the special profile for binaryPath if it is
+// recognized as a well-known system or Portmaster binary (eg.
+// "svchost.exe", "systemd-resolved", "portmaster-notifier"), or nil if
+// binaryPath isn't recognized.
+func DetectSpecialProfile(binaryPath string) *Profile {
+	provider := matchBinaryProvider(binaryPath)
+	if provider == nil {
+		return nil
+	}
+	return getSpecialProfile(provider.ID(), binaryPath)
+}
+
+func init() {
+	RegisterSpecialProfileProvider(staticSpecialProfileProvider{
+		id:          UnidentifiedProfileID,
+		name:        UnidentifiedProfileName,
+		description: UnidentifiedProfileDescription,
+	})
+	RegisterSpecialProfileProvider(staticSpecialProfileProvider{
+		id:          SystemProfileID,
+		name:        SystemProfileName,
+		description: SystemProfileDescription,
+	})
+	RegisterSpecialProfileProvider(staticSpecialProfileProvider{
+		id:          SystemResolverProfileID,
+		name:        SystemResolverProfileName,
+		description: SystemResolverProfileDescription,
+		config: map[string]interface{}{
+			// Explicitly setting the default action to "permit" will improve the
+			// user experience for people who set the global default to "prompt".
+			// Resolved domain from the system resolver are checked again when
+			// attributed to a connection of a regular process. Otherwise, users
+			// would see two connection prompts for the same domain.
+			CfgOptionDefaultActionKey: "permit",
+			// Explicitly allow localhost and answers to multicast protocols that
+			// are commonly used by system resolvers.
+			// TODO: When the Portmaster gains the ability to attribute multicast
+			// responses to their requests, these rules can probably be removed
+			// again.
+			CfgOptionServiceEndpointsKey: []string{
+				"+ Localhost",    // Allow everything from localhost.
+				"+ LAN UDP/5353", // Allow inbound mDNS requests and multicast replies.
+				"+ LAN UDP/5355", // Allow inbound LLMNR requests and multicast replies.
+				"+ LAN UDP/1900", // Allow inbound SSDP requests and multicast replies.
+			},
+			// Explicitly disable all filter lists, as these will be checked later
+			// with the attributed connection. As this is the system resolver, this
+			// list can instead be used as a global enforcement of filter lists, if
+			// the system resolver is used. Users who want to
+			CfgOptionFilterListsKey: []string{},
+		},
+	})
+	RegisterSpecialProfileProvider(staticSpecialProfileProvider{
+		id:          PortmasterProfileID,
+		name:        PortmasterProfileName,
+		description: PortmasterProfileDescription,
+		internal:    true,
+		names:       []string{"portmaster-core", "portmaster-core.exe"},
+	})
+	RegisterSpecialProfileProvider(staticSpecialProfileProvider{
+		id:          PortmasterAppProfileID,
+		name:        PortmasterAppProfileName,
+		description: PortmasterAppProfileDescription,
+		internal:    true,
+		names:       []string{"portmaster-app", "portmaster-app.exe"},
+		config: map[string]interface{}{
+			CfgOptionDefaultActionKey: "block",
+			CfgOptionEndpointsKey: []string{
+				"+ Localhost",
+				"+ .safing.io",
+			},
+		},
+	})
+	RegisterSpecialProfileProvider(staticSpecialProfileProvider{
+		id:          PortmasterNotifierProfileID,
+		name:        PortmasterNotifierProfileName,
+		description: PortmasterNotifierProfileDescription,
+		internal:    true,
+		names:       []string{"portmaster-notifier", "portmaster-notifier.exe"},
+		config: map[string]interface{}{
+			CfgOptionDefaultActionKey: "block",
+			CfgOptionEndpointsKey: []string{
+				"+ Localhost",
+			},
+		},
+	})
+}
+
+// staticSpecialProfileProvider is a SpecialProfileProvider whose name,
+// description and default config never depend on the binary path. It
+// covers Portmaster's own built-in profiles, which apply on every OS.
+type staticSpecialProfileProvider struct {
+	id          string
+	name        string
+	description string
+	config      map[string]interface{}
+	internal    bool
+	// names holds the binary file names this provider is recognized by, eg.
+	// "portmaster-notifier.exe". May be empty for profiles that are assigned
+	// some other way than binary name matching.
+	names []string
+}
+
+func (p staticSpecialProfileProvider) ID() string { return p.id }
+
+func (p staticSpecialProfileProvider) Metadata(_ string) (name, description string) {
+	return p.name, p.description
+}
+
+func (p staticSpecialProfileProvider) DefaultConfig() map[string]interface{} {
+	return p.config
+}
+
+func (p staticSpecialProfileProvider) Applies(_ string) bool {
+	return true
+}
+
+func (p staticSpecialProfileProvider) Matches(binaryPath string) bool {
+	return matchesBinaryName(binaryPath, p.names...)
+}
+
+func (p staticSpecialProfileProvider) Internal() bool { return p.internal }
+
+// internalProfileProvider is an optional SpecialProfileProvider extension
+// for providers whose profile should be marked Internal (ie. hidden from
+// the regular app list), such as Portmaster's own processes.
+type internalProfileProvider interface {
+	Internal() bool
+}
+
 func updateSpecialProfileMetadata(profile *Profile, binaryPath string) (ok, changed bool) {
-	// Get new profile name and check if profile is applicable to special handling.
-	var newProfileName, newDescription string
-	switch profile.ID {
-	case UnidentifiedProfileID:
-		newProfileName = UnidentifiedProfileName
-		newDescription = UnidentifiedProfileDescription
-	case SystemProfileID:
-		newProfileName = SystemProfileName
-		newDescription = SystemProfileDescription
-	case SystemResolverProfileID:
-		newProfileName = SystemResolverProfileName
-		newDescription = SystemResolverProfileDescription
-	case PortmasterProfileID:
-		newProfileName = PortmasterProfileName
-		newDescription = PortmasterProfileDescription
-	case PortmasterAppProfileID:
-		newProfileName = PortmasterAppProfileName
-		newDescription = PortmasterAppProfileDescription
-	case PortmasterNotifierProfileID:
-		newProfileName = PortmasterNotifierProfileName
-		newDescription = PortmasterNotifierProfileDescription
-	default:
+	provider := getSpecialProfileProvider(profile.ID)
+	if provider == nil {
 		return false, false
 	}
 
+	newProfileName, newDescription := provider.Metadata(binaryPath)
+
 	// Update profile name if needed.
 	if profile.Name != newProfileName {
 		profile.Name = newProfileName
@@ -101,137 +300,150 @@ func updateSpecialProfileMetadata(profile *Profile, binaryPath string) (ok, chan
 	}
 
 	// Update LinkedPath to new value.
+	linkedPathWarningID := fmt.Sprintf("profile:linked-path-mismatch:%s", profile.ID)
 	if profile.LinkedPath != binaryPath {
+		health.Set(
+			linkedPathWarningID,
+			"profile",
+			fmt.Sprintf(
+				"The special profile %q expected binary %q but found %q; the profile has been updated automatically.",
+				profile.Name, profile.LinkedPath, binaryPath,
+			),
+		)
 		profile.LinkedPath = binaryPath
 		changed = true
+	} else {
+		health.Clear(linkedPathWarningID)
 	}
 
-	return true, changed
-}
-
-func getSpecialProfile(profileID, linkedPath string) *Profile {
-	switch profileID {
-	case UnidentifiedProfileID:
-		return New(SourceLocal, UnidentifiedProfileID, linkedPath, nil)
-
-	case SystemProfileID:
-		return New(SourceLocal, SystemProfileID, linkedPath, nil)
-
-	case SystemResolverProfileID:
-		systemResolverProfile := New(
-			SourceLocal,
-			SystemResolverProfileID,
-			linkedPath,
-			map[string]interface{}{
-				// Explicitly setting the default action to "permit" will improve the
-				// user experience for people who set the global default to "prompt".
-				// Resolved domain from the system resolver are checked again when
-				// attributed to a connection of a regular process. Otherwise, users
-				// would see two connection prompts for the same domain.
-				CfgOptionDefaultActionKey: "permit",
-				// Explicitly allow localhost and answers to multicast protocols that
-				// are commonly used by system resolvers.
-				// TODO: When the Portmaster gains the ability to attribute multicast
-				// responses to their requests, these rules can probably be removed
-				// again.
-				CfgOptionServiceEndpointsKey: []string{
-					"+ Localhost",    // Allow everything from localhost.
-					"+ LAN UDP/5353", // Allow inbound mDNS requests and multicast replies.
-					"+ LAN UDP/5355", // Allow inbound LLMNR requests and multicast replies.
-					"+ LAN UDP/1900", // Allow inbound SSDP requests and multicast replies.
-				},
-				// Explicitly disable all filter lists, as these will be checked later
-				// with the attributed connection. As this is the system resolver, this
-				// list can instead be used as a global enforcement of filter lists, if
-				// the system resolver is used. Users who want to
-				CfgOptionFilterListsKey: []string{},
-			},
-		)
-		return systemResolverProfile
-
-	case PortmasterProfileID:
-		profile := New(SourceLocal, PortmasterProfileID, linkedPath, nil)
-		profile.Internal = true
-		return profile
-
-	case PortmasterAppProfileID:
-		profile := New(
-			SourceLocal,
-			PortmasterAppProfileID,
-			linkedPath,
-			map[string]interface{}{
-				CfgOptionDefaultActionKey: "block",
-				CfgOptionEndpointsKey: []string{
-					"+ Localhost",
-					"+ .safing.io",
-				},
-			},
-		)
-		profile.Internal = true
-		return profile
-
-	case PortmasterNotifierProfileID:
-		profile := New(
-			SourceLocal,
-			PortmasterNotifierProfileID,
-			linkedPath,
-			map[string]interface{}{
-				CfgOptionDefaultActionKey: "block",
-				CfgOptionEndpointsKey: []string{
-					"+ Localhost",
-				},
-			},
+	// Migrate the profile's config schema if needed. Unlike the old
+	// reset-the-whole-profile workaround, this only ever fills in new option
+	// defaults or renames keys, so it is safe to run even if the profile was
+	// already edited by the user.
+	schemaWarningID := fmt.Sprintf("profile:schema-outdated:%s", profile.ID)
+	if profile.SchemaVersion < CurrentSchemaVersion {
+		health.Set(
+			schemaWarningID,
+			"profile",
+			fmt.Sprintf("The special profile %q is running an outdated configuration schema and is being migrated to the current defaults.", profile.Name),
 		)
-		profile.Internal = true
-		return profile
+		if err := Migrate(profile); err != nil {
+			log.Warningf("profile: %s", err)
+		} else {
+			changed = true
+		}
+	}
+	if profile.SchemaVersion >= CurrentSchemaVersion {
+		health.Clear(schemaWarningID)
+	}
 
-	default:
-		return nil
+	if profile.ID == PortmasterNotifierProfileID {
+		checkNotifierReachability(profile)
 	}
+
+	return true, changed
 }
 
-// specialProfileNeedsReset is used as a workaround until we can properly use
-// profile layering in a way that it is also correctly handled by the UI. We
-// check if the special profile has not been changed by the user and if not,
-// check if the profile is outdated and can be upgraded.
-func specialProfileNeedsReset(profile *Profile) bool {
-	if profile == nil {
-		return false
+// checkNotifierReachability reports whether the Portmaster Notifier
+// profile's own config still permits the "+ Localhost" rule it needs to
+// reach the Portmaster Core. This tree has no firewall/connection-decision
+// package to observe actual blocked connections against, so this is a
+// config-level proxy for that check: if the user has edited the profile's
+// endpoint rules to no longer include "+ Localhost", the notifier has
+// effectively been cut off, even though no single connection attempt was
+// observed. A real connection-decision path, once it exists, should call
+// ReportNotifierUnreachable directly with its verdict instead.
+func checkNotifierReachability(profile *Profile) {
+	list, err := toStringList(profile.Config[CfgOptionEndpointsKey])
+	if err != nil {
+		// No endpoint rules (or an unreadable value) means the profile no
+		// longer grants localhost access either.
+		ReportNotifierUnreachable(true)
+		return
 	}
 
-	switch {
-	case profile.Source != SourceLocal:
-		// Special profiles live in the local scope only.
-		return false
-	case profile.LastEdited > 0:
-		// Profile was edited - don't override user settings.
-		return false
+	for _, rule := range list {
+		if rule == "+ Localhost" {
+			ReportNotifierUnreachable(false)
+			return
+		}
 	}
+	ReportNotifierUnreachable(true)
+}
+
+// ReportNotifierUnreachable raises or clears a health warning indicating
+// whether the Portmaster Notifier's expected localhost endpoint is
+// currently blocked by a user rule. checkNotifierReachability calls it based
+// on the Notifier profile's own config; a real firewall/connection-decision
+// path, once one exists in this tree, should call it directly with the
+// verdict from an actual evaluated connection instead.
+func ReportNotifierUnreachable(blocked bool) {
+	const warningID = "profile:notifier-unreachable"
 
-	switch profile.ID {
-	case SystemResolverProfileID:
-		return canBeUpgraded(profile, "20.11.2021")
-	case PortmasterAppProfileID:
-		return canBeUpgraded(profile, "8.9.2021")
-	default:
-		// Not a special profile or no upgrade available yet.
-		return false
+	if blocked {
+		health.Set(
+			warningID,
+			"profile",
+			"A user rule is blocking the Portmaster Notifier from reaching the Portmaster Core; the tray icon and desktop notifications may stop working.",
+		)
+		return
 	}
+
+	health.Clear(warningID)
 }
 
-func canBeUpgraded(profile *Profile, upgradeDate string) bool {
-	// Parse upgrade date.
-	upgradeTime, err := time.Parse("2.1.2006", upgradeDate)
-	if err != nil {
-		log.Warningf("profile: failed to parse date %q: %s", upgradeDate, err)
-		return false
+// osDaemonProvider is a SpecialProfileProvider for a single well-known
+// system daemon that only applies on one specific OS, eg. systemd-resolved
+// on Linux. OS-specific providers are registered from build-tagged files
+// (special_linux.go, special_darwin.go, special_windows.go), so contributors
+// can add a new daemon without touching this file.
+type osDaemonProvider struct {
+	id          string
+	goos        string
+	name        string
+	description string
+	config      map[string]interface{}
+	// names holds the binary file names this daemon is recognized by, eg.
+	// "systemd-resolved".
+	names []string
+}
+
+func (p osDaemonProvider) ID() string { return p.id }
+
+func (p osDaemonProvider) Metadata(_ string) (name, description string) {
+	return p.name, p.description
+}
+
+func (p osDaemonProvider) DefaultConfig() map[string]interface{} {
+	return p.config
+}
+
+func (p osDaemonProvider) Applies(goos string) bool {
+	return goos == p.goos
+}
+
+func (p osDaemonProvider) Matches(binaryPath string) bool {
+	return matchesBinaryName(binaryPath, p.names...)
+}
+
+func getSpecialProfile(profileID, linkedPath string) *Profile {
+	provider := getSpecialProfileProvider(profileID)
+	if provider == nil {
+		return nil
 	}
 
-	// Check if the upgrade is applicable.
-	if profile.Created < upgradeTime.Unix() {
-		log.Infof("profile: upgrading special profile %s", profile.ScopedID())
-		return true
+	name, description := provider.Metadata(linkedPath)
+	profile := New(SourceLocal, profileID, linkedPath, provider.DefaultConfig())
+	profile.Name = name
+	profile.Description = description
+	// Profiles created fresh from a provider already match the current
+	// defaults, so they start out at the current schema version and never
+	// need to run through Migrate.
+	profile.SchemaVersion = CurrentSchemaVersion
+
+	if internalProvider, ok := provider.(internalProfileProvider); ok && internalProvider.Internal() {
+		profile.Internal = true
 	}
 
-	return false
+	return profile
 }
@@ -0,0 +1,76 @@
+//go:build darwin
+
+package profile
+
+const (
+	// MDNSResponderProfileID is the profile ID used for mDNSResponder.
+	MDNSResponderProfileID = "_macos-mdnsresponder"
+	// MDNSResponderProfileName is the name used for mDNSResponder.
+	MDNSResponderProfileName = "macOS mDNSResponder"
+	// MDNSResponderProfileDescription is the description used for mDNSResponder.
+	MDNSResponderProfileDescription = `mDNSResponder is macOS' system DNS resolver and multicast DNS (Bonjour) responder.`
+
+	// ConfigdProfileID is the profile ID used for configd.
+	ConfigdProfileID = "_macos-configd"
+	// ConfigdProfileName is the name used for configd.
+	ConfigdProfileName = "macOS System Configuration"
+	// ConfigdProfileDescription is the description used for configd.
+	ConfigdProfileDescription = `configd manages macOS' network configuration, including DHCP, and may trigger captive portal and network reachability checks.`
+
+	// TrustdProfileID is the profile ID used for trustd.
+	TrustdProfileID = "_macos-trustd"
+	// TrustdProfileName is the name used for trustd.
+	TrustdProfileName = "macOS Trust Evaluation"
+	// TrustdProfileDescription is the description used for trustd.
+	TrustdProfileDescription = `trustd evaluates certificate trust on macOS and needs to reach Apple's OCSP and CRL servers to check for revoked certificates.`
+)
+
+func init() {
+	RegisterSpecialProfileProvider(osDaemonProvider{
+		id:          MDNSResponderProfileID,
+		goos:        "darwin",
+		names:       []string{"mDNSResponder"},
+		name:        MDNSResponderProfileName,
+		description: MDNSResponderProfileDescription,
+		config: map[string]interface{}{
+			CfgOptionDefaultActionKey: "permit",
+			CfgOptionServiceEndpointsKey: []string{
+				"+ Localhost",    // Allow everything from localhost.
+				"+ LAN UDP/5353", // Allow inbound mDNS requests and multicast replies.
+				"+ LAN UDP/5355", // Allow inbound LLMNR requests and multicast replies.
+				"+ LAN UDP/1900", // Allow inbound SSDP requests and multicast replies.
+			},
+			CfgOptionFilterListsKey: []string{},
+		},
+	})
+
+	RegisterSpecialProfileProvider(osDaemonProvider{
+		id:          ConfigdProfileID,
+		goos:        "darwin",
+		names:       []string{"configd"},
+		name:        ConfigdProfileName,
+		description: ConfigdProfileDescription,
+		config: map[string]interface{}{
+			CfgOptionDefaultActionKey: "block",
+			CfgOptionEndpointsKey: []string{
+				"+ Localhost",
+				"+ LAN", // DHCP and captive portal checks happen on the LAN.
+			},
+		},
+	})
+
+	RegisterSpecialProfileProvider(osDaemonProvider{
+		id:          TrustdProfileID,
+		goos:        "darwin",
+		names:       []string{"trustd"},
+		name:        TrustdProfileName,
+		description: TrustdProfileDescription,
+		config: map[string]interface{}{
+			// trustd needs to reach arbitrary OCSP/CRL endpoints on the
+			// internet, so it is left on the global default action.
+			CfgOptionEndpointsKey: []string{
+				"+ Localhost",
+			},
+		},
+	})
+}
@@ -0,0 +1,77 @@
+//go:build linux
+
+package profile
+
+const (
+	// SystemdResolvedProfileID is the profile ID used for systemd-resolved.
+	SystemdResolvedProfileID = "_linux-systemd-resolved"
+	// SystemdResolvedProfileName is the name used for systemd-resolved.
+	SystemdResolvedProfileName = "systemd-resolved"
+	// SystemdResolvedProfileDescription is the description used for systemd-resolved.
+	SystemdResolvedProfileDescription = `systemd-resolved is the system DNS resolver used by most modern Linux distributions.`
+
+	// NetworkManagerProfileID is the profile ID used for NetworkManager.
+	NetworkManagerProfileID = "_linux-networkmanager"
+	// NetworkManagerProfileName is the name used for NetworkManager.
+	NetworkManagerProfileName = "NetworkManager"
+	// NetworkManagerProfileDescription is the description used for NetworkManager.
+	NetworkManagerProfileDescription = `NetworkManager manages network connections on Linux, including DHCP and captive portal checks.`
+
+	// AvahiDaemonProfileID is the profile ID used for avahi-daemon.
+	AvahiDaemonProfileID = "_linux-avahi-daemon"
+	// AvahiDaemonProfileName is the name used for avahi-daemon.
+	AvahiDaemonProfileName = "Avahi mDNS/DNS-SD Daemon"
+	// AvahiDaemonProfileDescription is the description used for avahi-daemon.
+	AvahiDaemonProfileDescription = `avahi-daemon implements multicast DNS (mDNS) service discovery on Linux, comparable to Bonjour.`
+)
+
+func init() {
+	RegisterSpecialProfileProvider(osDaemonProvider{
+		id:          SystemdResolvedProfileID,
+		goos:        "linux",
+		names:       []string{"systemd-resolved"},
+		name:        SystemdResolvedProfileName,
+		description: SystemdResolvedProfileDescription,
+		config: map[string]interface{}{
+			CfgOptionDefaultActionKey: "permit",
+			CfgOptionServiceEndpointsKey: []string{
+				"+ Localhost",    // Allow everything from localhost.
+				"+ LAN UDP/5353", // Allow inbound mDNS requests and multicast replies.
+				"+ LAN UDP/5355", // Allow inbound LLMNR requests and multicast replies.
+				"+ LAN UDP/1900", // Allow inbound SSDP requests and multicast replies.
+			},
+			CfgOptionFilterListsKey: []string{},
+		},
+	})
+
+	RegisterSpecialProfileProvider(osDaemonProvider{
+		id:          NetworkManagerProfileID,
+		goos:        "linux",
+		names:       []string{"NetworkManager"},
+		name:        NetworkManagerProfileName,
+		description: NetworkManagerProfileDescription,
+		config: map[string]interface{}{
+			CfgOptionDefaultActionKey: "block",
+			CfgOptionEndpointsKey: []string{
+				"+ Localhost",
+				"+ LAN", // DHCP and captive portal checks happen on the LAN.
+			},
+		},
+	})
+
+	RegisterSpecialProfileProvider(osDaemonProvider{
+		id:          AvahiDaemonProfileID,
+		goos:        "linux",
+		names:       []string{"avahi-daemon"},
+		name:        AvahiDaemonProfileName,
+		description: AvahiDaemonProfileDescription,
+		config: map[string]interface{}{
+			CfgOptionDefaultActionKey: "permit",
+			CfgOptionServiceEndpointsKey: []string{
+				"+ Localhost",
+				"+ LAN UDP/5353", // Allow inbound mDNS requests and multicast replies.
+			},
+			CfgOptionFilterListsKey: []string{},
+		},
+	})
+}
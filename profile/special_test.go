@@ -0,0 +1,72 @@
+package profile
+
+import (
+	"testing"
+
+	"github.com/safing/portmaster/health"
+)
+
+func TestStaticProviderMatches(t *testing.T) {
+	provider := getSpecialProfileProvider(PortmasterNotifierProfileID)
+	if provider == nil {
+		t.Fatal("expected a provider to be registered for PortmasterNotifierProfileID")
+	}
+
+	if !provider.Matches("/usr/lib/portmaster/portmaster-notifier") {
+		t.Error("expected provider to match portmaster-notifier by base name")
+	}
+	if !provider.Matches(`C:\Program Files\Portmaster\portmaster-notifier.exe`) {
+		t.Error("expected provider to match portmaster-notifier.exe case-insensitively")
+	}
+	if provider.Matches("some-other-binary") {
+		t.Error("expected provider not to match an unrelated binary")
+	}
+}
+
+func TestDetectSpecialProfile(t *testing.T) {
+	profile := DetectSpecialProfile("/usr/lib/portmaster/portmaster-app")
+	if profile == nil {
+		t.Fatal("expected portmaster-app to be detected as a special profile")
+	}
+	if profile.ID != PortmasterAppProfileID {
+		t.Fatalf("expected profile ID %q, got %q", PortmasterAppProfileID, profile.ID)
+	}
+	if profile.LinkedPath != "/usr/lib/portmaster/portmaster-app" {
+		t.Fatalf("expected LinkedPath to be set to the detected binary, got %q", profile.LinkedPath)
+	}
+
+	if got := DetectSpecialProfile("/usr/bin/some-random-app"); got != nil {
+		t.Fatalf("expected no special profile for an unrecognized binary, got %+v", got)
+	}
+}
+
+func TestUpdateSpecialProfileMetadataReportsNotifierUnreachable(t *testing.T) {
+	const warningID = "profile:notifier-unreachable"
+
+	profile := getSpecialProfile(PortmasterNotifierProfileID, "/usr/lib/portmaster/portmaster-notifier")
+	if profile == nil {
+		t.Fatal("expected a Notifier profile to be created")
+	}
+
+	// Freshly created, the Notifier profile still has its default
+	// "+ Localhost" endpoint rule, so the warning should not be active.
+	updateSpecialProfileMetadata(profile, profile.LinkedPath)
+	if w, ok := health.Get(warningID); ok && w.Active {
+		t.Fatalf("expected warning %s to be inactive with the default config, got %+v", warningID, w)
+	}
+
+	// Simulate the user removing the "+ Localhost" rule.
+	profile.Config[CfgOptionEndpointsKey] = []string{}
+	updateSpecialProfileMetadata(profile, profile.LinkedPath)
+	w, ok := health.Get(warningID)
+	if !ok || !w.Active {
+		t.Fatalf("expected warning %s to be active once \"+ Localhost\" is removed, got %+v", warningID, w)
+	}
+
+	// Restoring the rule should clear the warning again.
+	profile.Config[CfgOptionEndpointsKey] = []string{"+ Localhost"}
+	updateSpecialProfileMetadata(profile, profile.LinkedPath)
+	if w, ok := health.Get(warningID); !ok || w.Active {
+		t.Fatalf("expected warning %s to be cleared once \"+ Localhost\" is restored, got %+v", warningID, w)
+	}
+}
@@ -0,0 +1,76 @@
+//go:build windows
+
+package profile
+
+const (
+	// WindowsSvchostProfileID is the profile ID used for svchost.exe.
+	WindowsSvchostProfileID = "_windows-svchost"
+	// WindowsSvchostProfileName is the name used for svchost.exe.
+	WindowsSvchostProfileName = "Windows Service Host"
+	// WindowsSvchostProfileDescription is the description used for svchost.exe.
+	WindowsSvchostProfileDescription = `svchost.exe hosts one or more Windows system services, including the DNS Client service, in a single shared process. Many unrelated services can run inside the same svchost.exe instance, so this profile deliberately allows common system resolver traffic.`
+
+	// WindowsSystemProfileID is the profile ID used for the Windows "System" process.
+	WindowsSystemProfileID = "_windows-system"
+	// WindowsSystemProfileName is the name used for the Windows "System" process.
+	WindowsSystemProfileName = "Windows System Process"
+	// WindowsSystemProfileDescription is the description used for the Windows "System" process.
+	WindowsSystemProfileDescription = `The "System" process represents kernel-level network activity on Windows, such as file and printer sharing.`
+
+	// WindowsSearchIndexerProfileID is the profile ID used for SearchIndexer.exe.
+	WindowsSearchIndexerProfileID = "_windows-searchindexer"
+	// WindowsSearchIndexerProfileName is the name used for SearchIndexer.exe.
+	WindowsSearchIndexerProfileName = "Windows Search Indexer"
+	// WindowsSearchIndexerProfileDescription is the description used for SearchIndexer.exe.
+	WindowsSearchIndexerProfileDescription = `SearchIndexer.exe builds the Windows Search index and may access indexed network shares.`
+)
+
+func init() {
+	RegisterSpecialProfileProvider(osDaemonProvider{
+		id:          WindowsSvchostProfileID,
+		goos:        "windows",
+		names:       []string{"svchost.exe"},
+		name:        WindowsSvchostProfileName,
+		description: WindowsSvchostProfileDescription,
+		config: map[string]interface{}{
+			CfgOptionDefaultActionKey: "permit",
+			CfgOptionServiceEndpointsKey: []string{
+				"+ Localhost",    // Allow everything from localhost.
+				"+ LAN UDP/5353", // Allow inbound mDNS requests and multicast replies.
+				"+ LAN UDP/5355", // Allow inbound LLMNR requests and multicast replies.
+				"+ LAN UDP/1900", // Allow inbound SSDP requests and multicast replies.
+			},
+			CfgOptionFilterListsKey: []string{},
+		},
+	})
+
+	RegisterSpecialProfileProvider(osDaemonProvider{
+		id:          WindowsSystemProfileID,
+		goos:        "windows",
+		names:       []string{"System"},
+		name:        WindowsSystemProfileName,
+		description: WindowsSystemProfileDescription,
+		config: map[string]interface{}{
+			CfgOptionDefaultActionKey: "block",
+			CfgOptionEndpointsKey: []string{
+				"+ Localhost",
+				"+ LAN", // File and printer sharing happens on the LAN.
+			},
+		},
+	})
+
+	RegisterSpecialProfileProvider(osDaemonProvider{
+		id:          WindowsSearchIndexerProfileID,
+		goos:        "windows",
+		names:       []string{"SearchIndexer.exe"},
+		name:        WindowsSearchIndexerProfileName,
+		description: WindowsSearchIndexerProfileDescription,
+		config: map[string]interface{}{
+			CfgOptionDefaultActionKey: "block",
+			CfgOptionEndpointsKey: []string{
+				"+ Localhost",
+				"+ LAN", // Indexing network shares happens on the LAN.
+			},
+		},
+	})
+}